@@ -1,27 +1,46 @@
 package chanrpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/name5566/leaf/conf"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// one server per goroutine (goroutine not safe)
-// one client per goroutine (goroutine not safe)
+//one server per goroutine (goroutine not safe)
+//one client per goroutine (goroutine not safe)
 
 //rpc服务器
 type Server struct {
-	functions map[interface{}]interface{} //id->func映射
-	ChanCall  chan *CallInfo              //用于传递调用信息的管道
+	functions    map[interface{}]interface{} //id->func映射
+	ChanCall     chan *CallInfo              //用于传递调用信息的管道
+	interceptors []Interceptor               //拦截器链,按Use的注册顺序从外到内包裹每一次Exec
+
+	clients sync.Map //已Open的客户端(*Client->struct{}),供Close()时统一通知
+
+	totalCalls     uint64                 //累计调用次数,原子操作
+	totalPanics    uint64                 //累计panic次数,原子操作
+	totalExecNanos int64                  //累计执行耗时(纳秒),原子操作
+	statsMu        sync.Mutex             //保护perIdCalls
+	perIdCalls     map[interface{}]uint64 //每个id的调用次数
 }
 
 //调用信息
 type CallInfo struct {
-	f       interface{}   //函数
-	args    []interface{} //参数
-	chanRet chan *RetInfo //返回值管道,用于传输返回值,可能是同步返回值管道,也可能是异步返回值管道
-	cb      interface{}   //回调
+	id      interface{}     //函数id,供拦截器链读取
+	f       interface{}     //函数
+	args    []interface{}   //参数
+	chanRet chan *RetInfo   //返回值管道,用于传输返回值,可能是同步返回值管道,也可能是异步返回值管道
+	cb      interface{}     //回调
+	ctx     context.Context //可选,调用的超时/取消上下文,设置后Exec会在执行前检查是否已取消
+	caller  interface{}     //可选,调用方身份,供拦截器链读取
+
+	streamChan chan interface{} //流式调用的数据管道,仅流式handler使用
+	streamDone <-chan struct{} //流式调用的取消信号,调用方放弃消费时关闭,仅流式handler使用
 }
 
 //返回信息
@@ -37,13 +56,25 @@ type Client struct {
 	chanSyncRet     chan *RetInfo //同步返回信息
 	ChanAsynRet     chan *RetInfo //异步返回信息
 	pendingAsynCall int           //待处理的异步调用计算器
+	MaxPendingAsync int           //待处理异步调用数的上限,0表示不限制,超出后AsynCall直接以ErrTooManyPending回调
+	Caller          interface{}   //调用方身份,可选,设置后会附到该客户端发起的每一次调用上,供拦截器链(CallCtx.Caller)读取,默认为nil
+
+	streamMu      sync.Mutex    //保护pendingStream
+	pendingStream []*streamCall //在途的流式调用,供Close()排空
+
+	serverClosed    chan struct{} //服务器关闭时会被关闭,通知客户端不要再等待尚未产生的回复
+	closeServerOnce sync.Once     //保证serverClosed只被关闭一次
 }
 
+//待处理的异步调用数超过Client.MaxPendingAsync时返回的错误
+var ErrTooManyPending = errors.New("chanrpc: too many pending async calls")
+
 //创建rpc服务器
 func NewServer(l int) *Server {
 	s := new(Server)                                //创建服务器
 	s.functions = make(map[interface{}]interface{}) //创建id->func映射
 	s.ChanCall = make(chan *CallInfo, l)            //创建用于传递调用信息的管道
+	s.perIdCalls = make(map[interface{}]uint64)     //创建每个id调用次数的统计
 	return s
 }
 
@@ -53,6 +84,7 @@ func (s *Server) Register(id interface{}, f interface{}) {
 	case func([]interface{}): //参数是切片,值任意,无返回值
 	case func([]interface{}) interface{}: //参数是切片,值任意,返回一个任意值
 	case func([]interface{}) []interface{}: //参数是切片,返回值也是切片,值均为任意
+	case func([]interface{}, chan<- interface{}, <-chan struct{}) error: //参数是切片,通过管道持续推送流式数据;第三个参数在调用方放弃消费时关闭,handler需配合select放弃继续推送,最终返回一个错误
 	default:
 		panic(fmt.Sprintf("function id %v: definition of function is invalid", id)) //id对应的函数定义非法
 	}
@@ -64,11 +96,40 @@ func (s *Server) Register(id interface{}, f interface{}) {
 	s.functions[id] = f //存储映射
 }
 
+//查询id对应的已注册函数的参数形态:0为无返回值,1为一个返回值,2为多个返回值,3为流式
+//供chanrpc/transport等跨进程网桥在不知道具体签名的情况下判断应如何调用
+func (s *Server) Arity(id interface{}) (n int, ok bool) {
+	f, registered := s.functions[id]
+	if !registered {
+		return 0, false
+	}
+
+	switch f.(type) {
+	case func([]interface{}):
+		return 0, true
+	case func([]interface{}) interface{}:
+		return 1, true
+	case func([]interface{}) []interface{}:
+		return 2, true
+	case func([]interface{}, chan<- interface{}, <-chan struct{}) error:
+		return 3, true
+	}
+
+	return 0, false
+}
+
 //执行RPC调用
 func (s *Server) Exec(ci *CallInfo) (err error) {
+	start := time.Now()
+	atomic.AddUint64(&s.totalCalls, 1) //统计调用次数
+	s.incIdCalls(ci.id)
+
 	//延迟处理异常
 	defer func() {
+		atomic.AddInt64(&s.totalExecNanos, int64(time.Since(start))) //统计执行耗时
+
 		if r := recover(); r != nil {
+			atomic.AddUint64(&s.totalPanics, 1) //统计panic次数
 			if conf.LenStackBuf > 0 {
 				buf := make([]byte, conf.LenStackBuf)
 				l := runtime.Stack(buf, false)
@@ -80,19 +141,47 @@ func (s *Server) Exec(ci *CallInfo) (err error) {
 		}
 	}()
 
-	switch ci.f.(type) { //判断f类型
-	case func([]interface{}): //无返回值
-		ci.f.(func([]interface{}))(ci.args) //执行调用
-		return s.ret(ci, &RetInfo{})        //返回值为空
-	case func([]interface{}) interface{}: //一个返回值
-		ret := ci.f.(func([]interface{}) interface{})(ci.args) //执行调用
-		return s.ret(ci, &RetInfo{ret: ret})                   //一个返回值
-	case func([]interface{}) []interface{}: //n个返回值
-		ret := ci.f.(func([]interface{}) []interface{})(ci.args) //执行调用
-		return s.ret(ci, &RetInfo{ret: ret})                     //多个返回值
+	if ci.ctx != nil { //调用携带了超时/取消上下文
+		select {
+		case <-ci.ctx.Done(): //已经被取消,不再执行,直接返回取消原因
+			return s.ret(ci, &RetInfo{err: ci.ctx.Err()})
+		default:
+		}
 	}
 
-	panic("bug")
+	ret, callErr := s.call(ci)
+	return s.ret(ci, &RetInfo{ret: ret, err: callErr})
+}
+
+//执行真正的handler,若注册了拦截器链,则经由链依次包裹后再到达handler
+func (s *Server) call(ci *CallInfo) (interface{}, error) {
+	invoke := func() (interface{}, error) {
+		switch ci.f.(type) { //判断f类型
+		case func([]interface{}): //无返回值
+			ci.f.(func([]interface{}))(ci.args) //执行调用
+			return nil, nil                     //返回值为空
+		case func([]interface{}) interface{}: //一个返回值
+			return ci.f.(func([]interface{}) interface{})(ci.args), nil //执行调用,一个返回值
+		case func([]interface{}) []interface{}: //n个返回值
+			return ci.f.(func([]interface{}) []interface{})(ci.args), nil //执行调用,多个返回值
+		case func([]interface{}, chan<- interface{}, <-chan struct{}) error: //流式handler,持续推送数据,结束后返回一个错误
+			return nil, ci.f.(func([]interface{}, chan<- interface{}, <-chan struct{}) error)(ci.args, ci.streamChan, ci.streamDone)
+		}
+		panic("bug")
+	}
+
+	if len(s.interceptors) == 0 { //没有注册拦截器,直接执行
+		return invoke()
+	}
+
+	cctx := &CallCtx{Id: ci.id, Args: ci.args, Caller: ci.caller, StartTime: time.Now()}
+	next := invoke
+	for i := len(s.interceptors) - 1; i >= 0; i-- { //从后往前包裹,保证按注册顺序从外到内执行
+		interceptor := s.interceptors[i]
+		prevNext := next
+		next = func() (interface{}, error) { return interceptor(cctx, prevNext) }
+	}
+	return next()
 }
 
 //rpc服务器调用自己
@@ -107,6 +196,7 @@ func (s *Server) Go(id interface{}, args ...interface{}) {
 	}()
 
 	s.ChanCall <- &CallInfo{ //将调用消息通过管道传输到rpc服务器
+		id:   id,
 		f:    f,
 		args: args,
 	}
@@ -121,6 +211,11 @@ func (s *Server) Close() {
 			err: errors.New("chanrpc server closed"),
 		})
 	}
+
+	s.clients.Range(func(key, _ interface{}) bool { //通知所有已打开的客户端:不会再有新的回复了
+		key.(*Client).notifyServerClosed()
+		return true
+	})
 }
 
 //打开一个rpc客户端
@@ -129,6 +224,8 @@ func (s *Server) Open(l int) *Client {
 	c.s = s                                //保存rpc服务器引用
 	c.chanSyncRet = make(chan *RetInfo, 1) //创建一个管道用于传输同步调用返回信息,同步调用的管道大小一定为1,因为调用以后就需要阻塞读取返回
 	c.ChanAsynRet = make(chan *RetInfo, l) //创建一个管道用于传输异步调用返回信息,异步调用的管道大小不一定为1
+	c.serverClosed = make(chan struct{})   //创建服务器关闭通知管道
+	s.clients.Store(c, struct{}{})         //登记客户端,供Close()统一通知
 	return c                               //返回rpc客户端
 }
 
@@ -165,6 +262,8 @@ func (c *Client) f(id interface{}, n int) (f interface{}, err error) {
 		_, ok = f.(func([]interface{}) interface{}) //n为1,一个返回值
 	case 2:
 		_, ok = f.(func([]interface{}) []interface{}) //n为2,多个返回值
+	case 3:
+		_, ok = f.(func([]interface{}, chan<- interface{}, <-chan struct{}) error) //n为3,流式handler
 	default:
 		panic("bug")
 	}
@@ -197,6 +296,23 @@ func (c *Client) call(ci *CallInfo, block bool) (err error) {
 	return
 }
 
+//发起调用(带超时/取消的context版本),发送阶段在ctx被取消时提前返回
+func (c *Client) callContext(ctx context.Context, ci *CallInfo) (err error) {
+	defer func() { //延迟捕获异常
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+
+	select {
+	case c.s.ChanCall <- ci: //将调用消息通过管道传输到rpc服务器
+	case <-ctx.Done(): //ctx已取消,放弃发送
+		err = ctx.Err()
+	}
+
+	return
+}
+
 //call0 call1 calln 可以将0 1 n记作0个返回值,1个返回值,n个返回值
 
 //调用0
@@ -208,9 +324,11 @@ func (c *Client) Call0(id interface{}, args ...interface{}) error {
 	}
 
 	err = c.call(&CallInfo{ //发起调用
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet, //同步返回管道
+		caller:  c.Caller,
 	}, true)
 
 	if err != nil {
@@ -221,6 +339,36 @@ func (c *Client) Call0(id interface{}, args ...interface{}) error {
 	return ri.err         //返回错误字段,代表是否有错
 }
 
+//调用0(带超时/取消的context版本)
+func (c *Client) Call0Context(ctx context.Context, id interface{}, args ...interface{}) error {
+	f, err := c.f(id, 0) //获取f
+	if err != nil {
+		return err
+	}
+
+	chanRet := make(chan *RetInfo, 1) //独立的返回管道,避免和c.chanSyncRet共用导致超时后姗姗来迟的结果串给下一次调用
+
+	err = c.callContext(ctx, &CallInfo{ //发起调用
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: chanRet,
+		ctx:     ctx,
+		caller:  c.Caller,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case ri := <-chanRet: //读取结果
+		return ri.err
+	case <-ctx.Done(): //等待超时,丢弃稍后才会到达的结果,避免污染下一次同步调用
+		go func() { <-chanRet }()
+		return ctx.Err()
+	}
+}
+
 //调用1
 //适合参数是切片,值任意,返回值为一个任意值
 func (c *Client) Call1(id interface{}, args ...interface{}) (interface{}, error) {
@@ -230,9 +378,11 @@ func (c *Client) Call1(id interface{}, args ...interface{}) (interface{}, error)
 	}
 
 	err = c.call(&CallInfo{ //发起调用
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet, //同步返回管道
+		caller:  c.Caller,
 	}, true)
 
 	if err != nil {
@@ -243,6 +393,36 @@ func (c *Client) Call1(id interface{}, args ...interface{}) (interface{}, error)
 	return ri.ret, ri.err //返回返回值字段和错误字段
 }
 
+//调用1(带超时/取消的context版本)
+func (c *Client) Call1Context(ctx context.Context, id interface{}, args ...interface{}) (interface{}, error) {
+	f, err := c.f(id, 1) //获取f
+	if err != nil {
+		return nil, err
+	}
+
+	chanRet := make(chan *RetInfo, 1) //独立的返回管道,避免和c.chanSyncRet共用导致超时后姗姗来迟的结果串给下一次调用
+
+	err = c.callContext(ctx, &CallInfo{ //发起调用
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: chanRet,
+		ctx:     ctx,
+		caller:  c.Caller,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case ri := <-chanRet: //读取结果
+		return ri.ret, ri.err
+	case <-ctx.Done(): //等待超时,丢弃稍后才会到达的结果,避免污染下一次同步调用
+		go func() { <-chanRet }()
+		return nil, ctx.Err()
+	}
+}
+
 //调用N
 //适合参数是切片,返回值也是切片,值均为任意
 func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, error) {
@@ -252,9 +432,11 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	}
 
 	err = c.call(&CallInfo{ //发起调用
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet, //同步返回管道
+		caller:  c.Caller,
 	}, true)
 
 	if err != nil {
@@ -265,18 +447,54 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	return ri.ret.([]interface{}), ri.err //返回返回值字段(先转化类型)和错误字段
 }
 
+//调用N(带超时/取消的context版本)
+func (c *Client) CallNContext(ctx context.Context, id interface{}, args ...interface{}) ([]interface{}, error) {
+	f, err := c.f(id, 2) //获取f
+	if err != nil {
+		return nil, err
+	}
+
+	chanRet := make(chan *RetInfo, 1) //独立的返回管道,避免和c.chanSyncRet共用导致超时后姗姗来迟的结果串给下一次调用
+
+	err = c.callContext(ctx, &CallInfo{ //发起调用
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: chanRet,
+		ctx:     ctx,
+		caller:  c.Caller,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case ri := <-chanRet: //读取结果
+		return ri.ret.([]interface{}), ri.err
+	case <-ctx.Done(): //等待超时,丢弃稍后才会到达的结果,避免污染下一次同步调用
+		go func() { <-chanRet }()
+		return nil, ctx.Err()
+	}
+}
+
 //发起异步调用(内部的)
 func (c *Client) asynCall(id interface{}, args []interface{}, cb interface{}, n int) error {
+	if c.MaxPendingAsync > 0 && c.pendingAsynCall >= c.MaxPendingAsync { //待处理的异步调用数已达上限,拒绝新的调用而不是无限堆积
+		return ErrTooManyPending
+	}
+
 	f, err := c.f(id, n) //获得f
 	if err != nil {
 		return err
 	}
 
 	err = c.call(&CallInfo{ //发起调用
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.ChanAsynRet, //异步返回管道
 		cb:      cb,
+		caller:  c.Caller,
 	}, false)
 
 	if err != nil {
@@ -321,6 +539,68 @@ func (c *Client) AsynCall(id interface{}, _args ...interface{}) { //_args最后
 	}
 }
 
+//发起异步调用(内部的,带超时/取消的context版本)
+func (c *Client) asynCallContext(ctx context.Context, id interface{}, args []interface{}, cb interface{}, n int) error {
+	if c.MaxPendingAsync > 0 && c.pendingAsynCall >= c.MaxPendingAsync { //待处理的异步调用数已达上限,拒绝新的调用而不是无限堆积
+		return ErrTooManyPending
+	}
+
+	f, err := c.f(id, n) //获得f
+	if err != nil {
+		return err
+	}
+
+	err = c.callContext(ctx, &CallInfo{ //发起调用,发送阶段受ctx控制
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: c.ChanAsynRet, //异步返回管道
+		cb:      cb,
+		ctx:     ctx,
+		caller:  c.Caller,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.pendingAsynCall++ //增加待处理的异步调用计数器
+	return nil
+}
+
+//发起异步调用(导出的,带超时/取消的context版本)
+//需要自己写c.Cb(<-c.ChanAsynRet)执行回调
+func (c *Client) AsynCallContext(ctx context.Context, id interface{}, _args ...interface{}) { //_args最后一个是回调函数,前面的是rpc调用的参数
+	if len(_args) < 1 { //检查是否提供了回调函数参数
+		panic("callback function not found")
+	}
+
+	var args []interface{}
+	if len(_args) > 1 {
+		args = _args[:len(_args)-1] //取出rpc调用的参数
+	}
+
+	cb := _args[len(_args)-1] //取出回调函数
+	switch cb.(type) {        //判断回调函数的类型
+	case func(error): //只接收一个错误
+		err := c.asynCallContext(ctx, id, args, cb, 0) //发起异步调用(内部)
+		if err != nil {                                //调用失败,执行回调
+			cb.(func(error))(err)
+		}
+	case func(interface{}, error): //接收一个返回值和一个错误
+		err := c.asynCallContext(ctx, id, args, cb, 1) //发起异步调用(内部)
+		if err != nil {                                //调用失败,执行回调
+			cb.(func(interface{}, error))(nil, err)
+		}
+	case func([]interface{}, error): //接收多个返回值和一个错误
+		err := c.asynCallContext(ctx, id, args, cb, 2) //发起异步调用(内部)
+		if err != nil {                                //调用失败,执行回调
+			cb.(func([]interface{}, error))(nil, err)
+		}
+	default:
+		panic("definition of callback function is invalid")
+	}
+}
+
 //执行回调
 func (c *Client) Cb(ri *RetInfo) {
 	switch ri.cb.(type) { //判断回调类型
@@ -340,6 +620,34 @@ func (c *Client) Cb(ri *RetInfo) {
 //关闭rpc客户端
 func (c *Client) Close() {
 	for c.pendingAsynCall > 0 { //还存在未处理的异步调用,等待异步调用处理完毕,取出异步返回值,执行回调
-		c.Cb(<-c.ChanAsynRet)
+		select {
+		case ri := <-c.ChanAsynRet:
+			c.Cb(ri)
+		case <-c.serverClosed: //服务器已经关闭且不会再产生任何回复,避免永久阻塞在这里
+			c.discardPendingAsynCalls()
+		}
 	}
+
+	c.drainStreams() //还存在未结束的流式调用,同样排空,避免遗留的handler写入无人读取的管道
+
+	c.s.clients.Delete(c) //从Server.clients中摘除,否则每个Open过的客户端都会在该映射里永久残留
+}
+
+//服务器关闭后丢弃尚未收到回复的异步调用,但仍优先执行服务器关闭前已经产生的回复对应的回调
+func (c *Client) discardPendingAsynCalls() {
+	for c.pendingAsynCall > 0 {
+		select {
+		case ri := <-c.ChanAsynRet:
+			c.Cb(ri)
+		default:
+			c.pendingAsynCall = 0
+		}
+	}
+}
+
+//通知客户端:服务器已经关闭,不会再产生新的回复
+func (c *Client) notifyServerClosed() {
+	c.closeServerOnce.Do(func() {
+		close(c.serverClosed)
+	})
 }
@@ -0,0 +1,28 @@
+package chanrpc
+
+import "testing"
+
+//Client.Close必须把自己从Server.clients中摘除,否则每次Open/Close都会泄漏一个map条目
+func TestClientCloseRemovesFromServerClients(t *testing.T) {
+	s := NewServer(10)
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	var n int
+	c := s.Open(10)
+	s.clients.Range(func(key, _ interface{}) bool { n++; return true })
+	if n != 1 {
+		t.Fatalf("expected 1 client registered after Open, got %d", n)
+	}
+
+	c.Close()
+
+	n = 0
+	s.clients.Range(func(key, _ interface{}) bool { n++; return true })
+	if n != 0 {
+		t.Fatalf("expected 0 clients registered after Close, got %d", n)
+	}
+}
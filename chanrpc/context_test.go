@@ -0,0 +1,67 @@
+package chanrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+//Call1Context(以及Call0Context/CallNContext)在超时后必须丢弃一个专属的返回管道,
+//而不是和c.chanSyncRet共用——否则姗姗来迟的旧结果会串给同一个client后续的不相干调用
+func TestCallContextTimeoutDoesNotCrossWireLaterCall(t *testing.T) {
+	const slowId = "ctx_test.Slow"
+	const fastId = "ctx_test.Fast"
+
+	s := NewServer(10)
+	release := make(chan struct{})
+	s.Register(slowId, func(args []interface{}) interface{} {
+		<-release //一直占着Server唯一的worker,直到测试放行
+		return "slow-result"
+	})
+	s.Register(fastId, func(args []interface{}) interface{} { return "fast-result" })
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	c := s.Open(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.Call1Context(ctx, slowId)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	close(release) //放行慢调用,它的(现已无人关心的)结果不应影响下面这次调用
+
+	ret, err := c.Call1(fastId)
+	if err != nil {
+		t.Fatalf("Call1(fast): %v", err)
+	}
+	if ret != "fast-result" {
+		t.Fatalf("got cross-wired result %v, want fast-result", ret)
+	}
+}
+
+//Call0Context在ctx未超时的正常路径下应该正确读取自己的返回值
+func TestCall0ContextReturnsOwnResult(t *testing.T) {
+	const id = "ctx_test.Ok"
+
+	s := NewServer(10)
+	s.Register(id, func(args []interface{}) {})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	c := s.Open(1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.Call0Context(ctx, id); err != nil {
+		t.Fatalf("Call0Context: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package chanrpc
+
+import "time"
+
+//拦截器调用上下文,贯穿整条拦截器链,在链中的每一环之间传递
+type CallCtx struct {
+	Id        interface{}   //调用的函数id
+	Args      []interface{} //调用参数
+	Caller    interface{}   //调用方身份,来自发起调用的Client.Caller,默认为nil
+	StartTime time.Time     //调用开始时间
+}
+
+//拦截器,next代表链中下一环(最终到达真正的handler)
+//拦截器可以在调用前后插入日志、统计、鉴权、限流等逻辑,也可以不调用next直接短路返回
+type Interceptor func(ctx *CallCtx, next func() (interface{}, error)) (interface{}, error)
+
+//注册拦截器链,必须在调用Open()和Go()之前调用
+//多次调用Use会依次追加,Exec执行时按注册顺序从外到内包裹
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.interceptors = append(s.interceptors, interceptors...)
+}
@@ -0,0 +1,127 @@
+package chanrpc
+
+import (
+	"fmt"
+	"testing"
+)
+
+//拦截器链应当按Use的注册顺序从外到内包裹handler:外层的before先跑,内层的after先跑,
+//同时CallCtx.Caller应该来自发起调用的Client.Caller
+func TestInterceptorChainOrderingAndCaller(t *testing.T) {
+	const id = "interceptor_test.Echo"
+
+	s := NewServer(10)
+
+	var order []string
+	var gotCaller interface{}
+	s.Use(
+		func(ctx *CallCtx, next func() (interface{}, error)) (interface{}, error) {
+			order = append(order, "outer-before")
+			ret, err := next()
+			order = append(order, "outer-after")
+			return ret, err
+		},
+		func(ctx *CallCtx, next func() (interface{}, error)) (interface{}, error) {
+			order = append(order, "inner-before")
+			gotCaller = ctx.Caller
+			ret, err := next()
+			order = append(order, "inner-after")
+			return ret, err
+		},
+	)
+	s.Register(id, func(args []interface{}) interface{} { return args[0] })
+
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	c := s.Open(1)
+	c.Caller = "user-42"
+
+	ret, err := c.Call1(id, "hi")
+	if err != nil {
+		t.Fatalf("Call1: %v", err)
+	}
+	if ret != "hi" {
+		t.Fatalf("Call1: got %v, want hi", ret)
+	}
+
+	want := []string{"outer-before", "inner-before", "inner-after", "outer-after"}
+	if len(order) != len(want) {
+		t.Fatalf("interceptor order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("interceptor order = %v, want %v", order, want)
+		}
+	}
+
+	if gotCaller != "user-42" {
+		t.Fatalf("CallCtx.Caller = %v, want user-42", gotCaller)
+	}
+}
+
+//不调用next的拦截器应当直接短路返回,handler不应被执行
+func TestInterceptorShortCircuitSkipsHandler(t *testing.T) {
+	const id = "interceptor_test.NeverCalled"
+
+	s := NewServer(10)
+
+	called := false
+	s.Use(func(ctx *CallCtx, next func() (interface{}, error)) (interface{}, error) {
+		return "short-circuited", nil
+	})
+	s.Register(id, func(args []interface{}) interface{} {
+		called = true
+		return "real-result"
+	})
+
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	c := s.Open(1)
+	ret, err := c.Call1(id)
+	if err != nil {
+		t.Fatalf("Call1: %v", err)
+	}
+	if ret != "short-circuited" {
+		t.Fatalf("Call1: got %v, want short-circuited", ret)
+	}
+	if called {
+		t.Fatal("handler was invoked despite the interceptor not calling next()")
+	}
+}
+
+//拦截器可以自行recover,把handler的panic翻译成一个普通的error返回
+func TestInterceptorTranslatesPanicToError(t *testing.T) {
+	const id = "interceptor_test.Panics"
+
+	s := NewServer(10)
+
+	s.Use(func(ctx *CallCtx, next func() (interface{}, error)) (ret interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("recovered: %v", r)
+			}
+		}()
+		return next()
+	})
+	s.Register(id, func(args []interface{}) interface{} { panic("boom") })
+
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	c := s.Open(1)
+	_, err := c.Call1(id)
+	if err == nil || err.Error() != "recovered: boom" {
+		t.Fatalf("Call1: got err %v, want \"recovered: boom\"", err)
+	}
+}
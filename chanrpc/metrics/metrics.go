@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/name5566/leaf/chanrpc"
+)
+
+//Exporter 定时从一个chanrpc.Server拉取ServerStats,并以Prometheus文本暴露格式对外提供
+type Exporter struct {
+	Server *chanrpc.Server //被观测的chanrpc服务器
+	Name   string          //指标名前缀,默认"chanrpc"
+
+	mu    sync.RWMutex
+	stats chanrpc.ServerStats
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+//NewExporter 创建一个Exporter,并立即拉取一次数据,随后启动后台goroutine按interval定时拉取
+func NewExporter(server *chanrpc.Server, interval time.Duration) *Exporter {
+	e := &Exporter{
+		Server: server,
+		Name:   "chanrpc",
+		stop:   make(chan struct{}),
+	}
+	e.pull()
+	go e.run(interval)
+	return e
+}
+
+func (e *Exporter) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.pull()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *Exporter) pull() {
+	stats := e.Server.Stats()
+
+	e.mu.Lock()
+	e.stats = stats
+	e.mu.Unlock()
+}
+
+//停止后台拉取
+func (e *Exporter) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+}
+
+//ServeHTTP 将最近一次拉取到的数据以Prometheus文本暴露格式写出,可以直接注册为/metrics的handler
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	e.Write(w)
+}
+
+//Write 将最近一次拉取到的数据以Prometheus文本暴露格式写入w
+func (e *Exporter) Write(w io.Writer) {
+	e.mu.RLock()
+	stats := e.stats
+	e.mu.RUnlock()
+
+	fmt.Fprintf(w, "# HELP %s_chan_call_len 当前ChanCall管道中堆积的调用数\n", e.Name)
+	fmt.Fprintf(w, "# TYPE %s_chan_call_len gauge\n", e.Name)
+	fmt.Fprintf(w, "%s_chan_call_len %d\n", e.Name, stats.ChanCallLen)
+
+	fmt.Fprintf(w, "# HELP %s_chan_call_cap ChanCall管道的容量\n", e.Name)
+	fmt.Fprintf(w, "# TYPE %s_chan_call_cap gauge\n", e.Name)
+	fmt.Fprintf(w, "%s_chan_call_cap %d\n", e.Name, stats.ChanCallCap)
+
+	fmt.Fprintf(w, "# HELP %s_calls_total 累计调用次数\n", e.Name)
+	fmt.Fprintf(w, "# TYPE %s_calls_total counter\n", e.Name)
+	fmt.Fprintf(w, "%s_calls_total %d\n", e.Name, stats.TotalCalls)
+
+	fmt.Fprintf(w, "# HELP %s_panics_total 累计panic次数\n", e.Name)
+	fmt.Fprintf(w, "# TYPE %s_panics_total counter\n", e.Name)
+	fmt.Fprintf(w, "%s_panics_total %d\n", e.Name, stats.TotalPanics)
+
+	fmt.Fprintf(w, "# HELP %s_avg_exec_seconds 平均单次执行耗时(秒)\n", e.Name)
+	fmt.Fprintf(w, "# TYPE %s_avg_exec_seconds gauge\n", e.Name)
+	fmt.Fprintf(w, "%s_avg_exec_seconds %f\n", e.Name, stats.AvgExecTime.Seconds())
+
+	fmt.Fprintf(w, "# HELP %s_id_calls_total 按id统计的累计调用次数\n", e.Name)
+	fmt.Fprintf(w, "# TYPE %s_id_calls_total counter\n", e.Name)
+	for id, n := range stats.PerIdCalls {
+		fmt.Fprintf(w, "%s_id_calls_total{id=%q} %d\n", e.Name, fmt.Sprint(id), n)
+	}
+}
@@ -0,0 +1,111 @@
+package chanrpc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+//net/rpc风格的方法描述信息
+type methodType struct {
+	method    reflect.Method
+	ArgType   reflect.Type //请求参数类型
+	ReplyType reflect.Type //响应参数类型(指针类型),为nil表示方法只有error返回值
+}
+
+//调用反射注册的方法
+//args[0]即为ArgType对应的参数,返回值为ReplyType对应的指针(若方法只返回error则为nil)
+func (mt *methodType) call(rcvr reflect.Value, args []interface{}) interface{} {
+	argv := reflect.New(mt.ArgType)
+	if len(args) > 0 && args[0] != nil {
+		argv.Elem().Set(reflect.ValueOf(args[0]))
+	}
+
+	var in []reflect.Value
+	var replyv reflect.Value
+	if mt.ReplyType != nil {
+		replyv = reflect.New(mt.ReplyType.Elem())
+		in = []reflect.Value{argv.Elem(), replyv}
+	} else {
+		in = []reflect.Value{argv.Elem()}
+	}
+
+	out := mt.method.Func.Call(append([]reflect.Value{rcvr}, in...))
+	if errv := out[len(out)-1]; !errv.IsNil() { //方法返回了非nil的error,以panic的形式交给Exec的recover统一处理
+		panic(errv.Interface().(error))
+	}
+
+	if mt.ReplyType != nil {
+		return replyv.Interface()
+	}
+	return nil
+}
+
+//注册rcvr的所有导出方法,方法id为"Type.Method"
+func (s *Server) RegisterService(rcvr interface{}) {
+	s.RegisterServiceName(reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name(), rcvr)
+}
+
+//注册rcvr的所有导出方法,方法id为"name.Method"
+func (s *Server) RegisterServiceName(name string, rcvr interface{}) {
+	rcvrVal := reflect.ValueOf(rcvr)
+	rcvrType := rcvrVal.Type()
+
+	for i := 0; i < rcvrType.NumMethod(); i++ {
+		method := rcvrType.Method(i)
+		mt, err := suitableMethod(method)
+		if err != nil {
+			panic(fmt.Sprintf("chanrpc service %v: %v", name, err))
+		}
+		if mt == nil { //非导出方法或者签名不是rpc方法,跳过
+			continue
+		}
+
+		id := name + "." + method.Name
+		s.Register(id, mt.wrap(rcvrVal))
+	}
+}
+
+//将methodType适配为Call1可以识别的func([]interface{}) interface{}
+func (mt *methodType) wrap(rcvr reflect.Value) func([]interface{}) interface{} {
+	return func(args []interface{}) interface{} {
+		return mt.call(rcvr, args)
+	}
+}
+
+//检查method是否是形如func(*T)(Args, *Reply) error或func(*T)(Args) error的合法rpc方法
+func suitableMethod(method reflect.Method) (*methodType, error) {
+	if method.PkgPath != "" { //非导出方法
+		return nil, nil
+	}
+	if method.Type.IsVariadic() { //变长参数方法不支持
+		return nil, fmt.Errorf("method %v: variadic methods are not supported", method.Name)
+	}
+
+	mtype := method.Type
+	switch mtype.NumIn() {
+	case 2: //receiver, Args
+		if mtype.NumOut() != 1 {
+			return nil, nil
+		}
+		if mtype.Out(0) != typeOfError {
+			return nil, nil
+		}
+		return &methodType{method: method, ArgType: mtype.In(1)}, nil
+	case 3: //receiver, Args, *Reply
+		if mtype.NumOut() != 1 {
+			return nil, nil
+		}
+		if mtype.Out(0) != typeOfError {
+			return nil, nil
+		}
+		replyType := mtype.In(2)
+		if replyType.Kind() != reflect.Ptr {
+			return nil, nil
+		}
+		return &methodType{method: method, ArgType: mtype.In(1), ReplyType: replyType}, nil
+	default:
+		return nil, nil
+	}
+}
+
+var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
@@ -0,0 +1,115 @@
+package chanrpc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type arithArgs struct {
+	A, B int
+}
+
+type arithReply struct {
+	C int
+}
+
+//okArith 覆盖(Args,*Reply)error和(Args)error两种合法签名,以及方法返回非nil error的情形
+type okArith struct{}
+
+func (*okArith) Multiply(args arithArgs, reply *arithReply) error {
+	reply.C = args.A * args.B
+	return nil
+}
+
+func (*okArith) Divide(args arithArgs, reply *arithReply) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	reply.C = args.A / args.B
+	return nil
+}
+
+func (*okArith) Ping(args arithArgs) error {
+	return nil
+}
+
+//badArith 只有一个变长参数方法,注册时应当直接panic
+type badArith struct{}
+
+func (*badArith) Sum(args arithArgs, more ...int) error {
+	return nil
+}
+
+func newTestServer() (*Server, *Client) {
+	s := NewServer(10)
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	return s, s.Open(1)
+}
+
+func TestRegisterServiceCallsMethodWithReply(t *testing.T) {
+	s, c := newTestServer()
+	s.RegisterService(new(okArith))
+
+	ret, err := c.Call1("okArith.Multiply", arithArgs{A: 3, B: 4})
+	if err != nil {
+		t.Fatalf("Multiply: %v", err)
+	}
+	if reply := ret.(*arithReply); reply.C != 12 {
+		t.Fatalf("Multiply: got %d, want 12", reply.C)
+	}
+}
+
+func TestRegisterServiceCallsMethodWithoutReply(t *testing.T) {
+	s, c := newTestServer()
+	s.RegisterService(new(okArith))
+
+	ret, err := c.Call1("okArith.Ping", arithArgs{})
+	if err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if ret != nil {
+		t.Fatalf("Ping: got %v, want nil reply", ret)
+	}
+}
+
+//方法返回非nil error时,methodType.call以panic的方式交给Exec统一recover,
+//最终必须变成Call1返回的错误(错误信息中包含原error的内容),而不是让整个Server崩溃
+func TestRegisterServiceMethodErrorPropagatesThroughCall(t *testing.T) {
+	s, c := newTestServer()
+	s.RegisterService(new(okArith))
+
+	_, err := c.Call1("okArith.Divide", arithArgs{A: 1, B: 0})
+	if err == nil || !strings.Contains(err.Error(), "divide by zero") {
+		t.Fatalf("Divide: got err %v, want it to mention the divide-by-zero error", err)
+	}
+
+	//Server的worker goroutine应该还活着,panic没有把它打垮
+	ret, err := c.Call1("okArith.Multiply", arithArgs{A: 2, B: 5})
+	if err != nil {
+		t.Fatalf("Multiply after Divide panic: %v", err)
+	}
+	if reply := ret.(*arithReply); reply.C != 10 {
+		t.Fatalf("Multiply after Divide panic: got %d, want 10", reply.C)
+	}
+}
+
+func TestRegisterServiceRejectsVariadicMethod(t *testing.T) {
+	s := NewServer(10)
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("expected RegisterService to panic on a variadic method")
+		}
+		if !strings.Contains(r.(string), "variadic") {
+			t.Fatalf("panic message %q does not mention variadic methods", r)
+		}
+	}()
+
+	s.RegisterService(new(badArith))
+}
@@ -0,0 +1,54 @@
+package chanrpc
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+//ServerStats 服务器运行状态快照,由Server.Stats()返回
+type ServerStats struct {
+	ChanCallLen int                    //ChanCall当前堆积的调用数
+	ChanCallCap int                    //ChanCall的容量
+	TotalCalls  uint64                 //累计调用次数
+	TotalPanics uint64                 //累计panic次数
+	AvgExecTime time.Duration          //平均单次执行耗时
+	PerIdCalls  map[interface{}]uint64 //每个id的累计调用次数
+}
+
+//获取服务器当前的运行状态,用于观测ChanCall是否积压、调用是否频繁panic等
+func (s *Server) Stats() ServerStats {
+	total := atomic.LoadUint64(&s.totalCalls)
+
+	var avg time.Duration
+	if total > 0 {
+		avg = time.Duration(atomic.LoadInt64(&s.totalExecNanos) / int64(total))
+	}
+
+	s.statsMu.Lock()
+	perId := make(map[interface{}]uint64, len(s.perIdCalls))
+	for id, n := range s.perIdCalls {
+		perId[id] = n
+	}
+	s.statsMu.Unlock()
+
+	return ServerStats{
+		ChanCallLen: len(s.ChanCall),
+		ChanCallCap: cap(s.ChanCall),
+		TotalCalls:  total,
+		TotalPanics: atomic.LoadUint64(&s.totalPanics),
+		AvgExecTime: avg,
+		PerIdCalls:  perId,
+	}
+}
+
+//累加id的调用次数
+func (s *Server) incIdCalls(id interface{}) {
+	s.statsMu.Lock()
+	s.perIdCalls[id]++
+	s.statsMu.Unlock()
+}
+
+//获取当前待处理的异步调用数,用于配合MaxPendingAsync观测背压
+func (c *Client) PendingAsync() int {
+	return c.pendingAsynCall
+}
@@ -0,0 +1,101 @@
+package chanrpc
+
+import "context"
+
+//流式调用的数据管道默认容量
+const defaultStreamChanLen = 64
+
+//一次在途的流式调用,供Client.Close()排空
+type streamCall struct {
+	streamChan chan interface{} //数据管道
+	chanRet    chan *RetInfo    //承载handler结束时的终态错误
+	errChan    chan error       //导出给调用方的错误管道
+}
+
+//流式调用
+//适合返回数量不确定的一系列值的场景,如分页排行榜、聊天记录、渐进式AOI更新等
+//handler通过chan<- interface{}持续推送数据,并配合ctx.Done()在调用方放弃消费时及时返回,
+//否则一个慢消费者(只读第一条就不再消费)会让handler永远阻塞在向已满的数据管道推送,进而卡死整个Server
+//返回的数据管道在handler结束(或出错)后关闭,随后错误管道才会产生一个值,即handler返回的错误;
+//ctx被取消时只会关闭传给handler的done管道,数据管道要等handler返回后才关闭,错误管道收到的仍是handler返回的错误而不是ctx.Err()
+func (c *Client) CallStream(ctx context.Context, id interface{}, args ...interface{}) (<-chan interface{}, <-chan error) {
+	errChan := make(chan error, 1)
+
+	f, err := c.f(id, 3) //获取f,n为3表示流式handler
+	if err != nil {
+		errChan <- err
+		return nil, errChan
+	}
+
+	streamChan := make(chan interface{}, defaultStreamChanLen)
+	chanRet := make(chan *RetInfo, 1) //独立的返回管道,避免和同步调用共用的chanSyncRet互相干扰
+
+	err = c.call(&CallInfo{ //发起调用
+		id:         id,
+		f:          f,
+		args:       args,
+		chanRet:    chanRet,
+		streamChan: streamChan,
+		streamDone: ctx.Done(),
+		caller:     c.Caller,
+	}, true)
+	if err != nil {
+		errChan <- err
+		return nil, errChan
+	}
+
+	sc := &streamCall{streamChan: streamChan, chanRet: chanRet, errChan: errChan}
+	c.streamMu.Lock()
+	c.pendingStream = append(c.pendingStream, sc)
+	c.streamMu.Unlock()
+
+	go func() { //等待handler结束,转发终态错误,并关闭数据管道通知消费者
+		ri := <-chanRet
+		close(streamChan)
+		errChan <- ri.err
+		c.removeStream(sc)
+	}()
+
+	return streamChan, errChan
+}
+
+//从在途流式调用列表中移除
+func (c *Client) removeStream(sc *streamCall) {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+
+	for i, s := range c.pendingStream {
+		if s == sc {
+			c.pendingStream = append(c.pendingStream[:i], c.pendingStream[i+1:]...)
+			return
+		}
+	}
+}
+
+//排空所有在途的流式调用,丢弃剩余数据直到数据管道关闭,再读取终态错误
+func (c *Client) drainStreams() {
+	c.streamMu.Lock()
+	streams := c.pendingStream
+	c.pendingStream = nil
+	c.streamMu.Unlock()
+
+	for _, sc := range streams {
+		c.drainStream(sc)
+	}
+}
+
+//排空一个流式调用,同样借助c.serverClosed避免永久阻塞:服务器关闭后,一个还在运行的
+//handler(比如用context.Background()发起、本就无意取消的调用)可能永远不会让streamChan关闭
+func (c *Client) drainStream(sc *streamCall) {
+	for {
+		select {
+		case _, ok := <-sc.streamChan:
+			if !ok { //数据管道已关闭,说明handler已结束,终态错误紧随其后
+				<-sc.errChan
+				return
+			}
+		case <-c.serverClosed: //服务器已关闭且不会再有回复,不再等待一个可能永不结束的流
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package chanrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+//回归测试:消费者放弃读取流式调用的数据管道时,handler必须能借助streamDone及时返回,
+//而不是永远阻塞在向已满的数据管道推送——否则会一直占着Server唯一的处理goroutine,
+//连带卡死同一个Server上毫不相干的其它调用
+func TestCallStreamAbandonedConsumerDoesNotWedgeServer(t *testing.T) {
+	const streamID = "stream_test.Feed"
+	const echoID = "stream_test.Echo"
+
+	s := NewServer(64)
+	s.Register(streamID, func(args []interface{}, data chan<- interface{}, done <-chan struct{}) error {
+		for i := 0; ; i++ {
+			select {
+			case data <- i:
+			case <-done: //调用方放弃消费,不再徒劳等待数据管道腾出空间
+				return errors.New("stream: abandoned")
+			}
+		}
+	})
+	s.Register(echoID, func(args []interface{}) interface{} { return args[0] })
+
+	go func() { //Server只有一个worker,串行处理ChanCall,复现"流式调用卡住就连累其它调用"的场景
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	c := s.Open(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	dataChan, errChan := c.CallStream(ctx, streamID)
+
+	//消费者完全不读取,handler很快会填满streamChan的缓冲区并阻塞在下一次推送上
+
+	echoDone := make(chan error, 1)
+	go func() {
+		_, err := s.Open(1).Call1(echoID, "hi")
+		echoDone <- err
+	}()
+
+	cancel() //模拟消费者放弃消费
+
+	select {
+	case err := <-errChan:
+		if err == nil {
+			t.Fatal("expected an error after abandoning the stream, got nil")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler did not return after streamDone was closed")
+	}
+
+	for range dataChan { //数据管道应随handler返回而关闭
+	}
+
+	select {
+	case err := <-echoDone:
+		if err != nil {
+			t.Fatalf("unrelated Call1 failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unrelated call never completed: server stayed wedged by the abandoned stream")
+	}
+}
+
+//回归测试:一个用context.Background()发起、本就无意取消的流式调用在Server.Close()之后
+//应该让Client.Close()照常返回,而不是永远等待一个handler可能永不会结束的流
+func TestClientCloseReturnsAfterServerCloseWithInfiniteStream(t *testing.T) {
+	const id = "stream_test.Infinite"
+
+	s := NewServer(10)
+	s.Register(id, func(args []interface{}, data chan<- interface{}, done <-chan struct{}) error {
+		for i := 0; ; i++ {
+			select {
+			case data <- i:
+			case <-done:
+				return errors.New("stream: abandoned")
+			}
+		}
+	})
+
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	c := s.Open(1)
+	dataChan, _ := c.CallStream(context.Background(), id)
+	<-dataChan //读一条数据,确认handler已经在跑
+
+	s.Close() //通知所有已打开的客户端:服务器关闭了
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Client.Close() hung on an in-flight stream after Server.Close()")
+	}
+}
@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"sync"
+)
+
+//RemoteClient 通过网络连接到TransportServer,对外提供与chanrpc.Client一致的Call0/Call1/CallN/AsynCall语义,
+//将本地-或-远程的调用统一成同一套模型:调用方无需关心handler究竟跑在本进程还是另一端
+//注意:帧本身固定是gob编码(见readLoop/call),codec参数只负责帧内参数/返回值的编解码,
+//因此目前仅限Go进程之间互通,不是一个可以让非Go对端接入的跨语言协议
+type RemoteClient struct {
+	conn  net.Conn
+	codec Codec
+	enc   *gob.Encoder
+	encMu sync.Mutex //gob.Encoder不是并发安全的
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]chan *response
+}
+
+//拨号连接addr,并启动后台goroutine持续读取响应按seq分发给对应的调用方
+func Dial(network, addr string, codec Codec) (*RemoteClient, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &RemoteClient{
+		conn:    conn,
+		codec:   codec,
+		enc:     gob.NewEncoder(conn),
+		pending: make(map[uint64]chan *response),
+	}
+	go rc.readLoop()
+	return rc, nil
+}
+
+func (rc *RemoteClient) readLoop() {
+	dec := gob.NewDecoder(bufio.NewReader(rc.conn))
+	for {
+		resp := new(response)
+		if err := dec.Decode(resp); err != nil {
+			rc.failAllPending(err)
+			return
+		}
+
+		rc.mu.Lock()
+		ch, ok := rc.pending[resp.Seq]
+		if ok {
+			delete(rc.pending, resp.Seq)
+		}
+		rc.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+//连接断开时,让所有尚未收到响应的调用方都能返回,而不是永久阻塞
+func (rc *RemoteClient) failAllPending(err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for seq, ch := range rc.pending {
+		ch <- &response{Seq: seq, Err: err.Error()}
+		delete(rc.pending, seq)
+	}
+}
+
+func (rc *RemoteClient) call(id string, args []interface{}) (*response, error) {
+	blobs, err := encodeValues(rc.codec, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rc.mu.Lock()
+	rc.seq++
+	seq := rc.seq
+	ch := make(chan *response, 1)
+	rc.pending[seq] = ch
+	rc.mu.Unlock()
+
+	rc.encMu.Lock()
+	err = rc.enc.Encode(&request{Seq: seq, Id: id, Args: blobs})
+	rc.encMu.Unlock()
+	if err != nil {
+		rc.mu.Lock()
+		delete(rc.pending, seq)
+		rc.mu.Unlock()
+		return nil, err
+	}
+
+	resp := <-ch
+	if resp.Err != "" {
+		return resp, fmt.Errorf("%s", resp.Err)
+	}
+	return resp, nil
+}
+
+//调用0,适合无返回值的handler
+func (rc *RemoteClient) Call0(id string, args ...interface{}) error {
+	_, err := rc.call(id, args)
+	return err
+}
+
+//调用1,适合一个返回值的handler;返回值按id通过RegisterReturnTypes注册的类型解码
+func (rc *RemoteClient) Call1(id string, args ...interface{}) (interface{}, error) {
+	resp, err := rc.call(id, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Ret) == 0 {
+		return nil, nil
+	}
+	return decodeOne(rc.codec, resp.Ret[0], lookupReturnType(id, 0))
+}
+
+//调用N,适合多个返回值的handler;每个位置按RegisterReturnTypes注册的类型解码
+func (rc *RemoteClient) CallN(id string, args ...interface{}) ([]interface{}, error) {
+	resp, err := rc.call(id, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rets := make([]interface{}, len(resp.Ret))
+	for i, blob := range resp.Ret {
+		v, err := decodeOne(rc.codec, blob, lookupReturnType(id, i))
+		if err != nil {
+			return nil, err
+		}
+		rets[i] = v
+	}
+	return rets, nil
+}
+
+//发起异步调用(导出的),cb在内部goroutine里被调用,支持与chanrpc.Client.AsynCall相同的三种回调签名
+func (rc *RemoteClient) AsynCall(id string, _args ...interface{}) {
+	if len(_args) < 1 {
+		panic("callback function not found")
+	}
+
+	var args []interface{}
+	if len(_args) > 1 {
+		args = _args[:len(_args)-1]
+	}
+	cb := _args[len(_args)-1]
+
+	switch cb.(type) {
+	case func(error):
+		go func() {
+			err := rc.Call0(id, args...)
+			cb.(func(error))(err)
+		}()
+	case func(interface{}, error):
+		go func() {
+			ret, err := rc.Call1(id, args...)
+			cb.(func(interface{}, error))(ret, err)
+		}()
+	case func([]interface{}, error):
+		go func() {
+			rets, err := rc.CallN(id, args...)
+			cb.(func([]interface{}, error))(rets, err)
+		}()
+	default:
+		panic("definition of callback function is invalid")
+	}
+}
+
+//关闭底层连接,所有尚未返回的调用都会收到连接关闭错误
+func (rc *RemoteClient) Close() error {
+	return rc.conn.Close()
+}
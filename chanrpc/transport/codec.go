@@ -0,0 +1,12 @@
+package transport
+
+//编解码器,负责在一个具体的Go值与它的线上字节表示之间转换
+//每个参数/返回值都独立编解码,因此Codec本身不需要知道调用的整体结构
+//注意:外层的{id,seq,args}/{seq,ret,err}帧仍然固定用encoding/gob编码(见serveConn/Dial),
+//Codec只决定帧内每个参数/返回值blob的编码方式,所以JSONCodec/ProtoCodec目前只能用于Go-to-Go的场景,
+//换成它们并不能让一个不理解gob帧格式的非Go对端接入
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
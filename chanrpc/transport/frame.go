@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"fmt"
+	"reflect"
+)
+
+//request 请求帧:{id, seq, args},Args中的每一项都是单独编码的字节序列
+type request struct {
+	Seq  uint64
+	Id   string
+	Args [][]byte
+}
+
+//response 响应帧:{seq, ret, err}
+type response struct {
+	Seq uint64
+	Ret [][]byte
+	Err string
+}
+
+//将参数逐个独立编码
+func encodeValues(codec Codec, values []interface{}) ([][]byte, error) {
+	blobs := make([][]byte, len(values))
+	for i, v := range values {
+		b, err := codec.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("transport: marshal arg %d: %w", i, err)
+		}
+		blobs[i] = b
+	}
+	return blobs, nil
+}
+
+//按注册的参数类型解码
+func decodeArgs(codec Codec, blobs [][]byte, types []reflect.Type) ([]interface{}, error) {
+	if len(blobs) != len(types) {
+		return nil, fmt.Errorf("transport: expect %d args, got %d", len(types), len(blobs))
+	}
+
+	args := make([]interface{}, len(blobs))
+	for i, b := range blobs {
+		v, err := decodeOne(codec, b, types[i])
+		if err != nil {
+			return nil, fmt.Errorf("transport: unmarshal arg %d: %w", i, err)
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+//按给定类型解码单个值,类型为nil时解码为interface{}(仅JSONCodec等自描述编码支持)
+func decodeOne(codec Codec, blob []byte, t reflect.Type) (interface{}, error) {
+	if t == nil {
+		var v interface{}
+		if err := codec.Unmarshal(blob, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+
+	p := reflect.New(t)
+	if err := codec.Unmarshal(blob, p.Interface()); err != nil {
+		return nil, err
+	}
+	return p.Elem().Interface(), nil
+}
@@ -0,0 +1,25 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+type gobCodec struct{}
+
+//GobCodec 基于encoding/gob的内置编解码器
+var GobCodec Codec = gobCodec{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
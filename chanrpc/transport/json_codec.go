@@ -0,0 +1,18 @@
+package transport
+
+import "encoding/json"
+
+type jsonCodec struct{}
+
+//JSONCodec 基于encoding/json的内置编解码器
+var JSONCodec Codec = jsonCodec{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
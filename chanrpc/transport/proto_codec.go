@@ -0,0 +1,36 @@
+package transport
+
+import "errors"
+
+//protoMarshaler/protoUnmarshaler是protobuf生成代码普遍实现的一对方法,这里不直接依赖某一个具体的protobuf库,
+//只要参数/返回值类型实现了这两个接口即可通过ProtoCodec编解码
+type protoMarshaler interface {
+	Marshal() ([]byte, error)
+}
+
+type protoUnmarshaler interface {
+	Unmarshal([]byte) error
+}
+
+type protoCodec struct{}
+
+//ProtoCodec 基于Marshal()/Unmarshal()接口的内置编解码器,适配由protobuf生成的消息类型
+var ProtoCodec Codec = protoCodec{}
+
+func (protoCodec) Name() string { return "protobuf" }
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(protoMarshaler)
+	if !ok {
+		return nil, errors.New("transport: value does not implement Marshal() ([]byte, error)")
+	}
+	return m.Marshal()
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(protoUnmarshaler)
+	if !ok {
+		return errors.New("transport: value does not implement Unmarshal([]byte) error")
+	}
+	return m.Unmarshal(data)
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+//参数/返回值类型注册表,使codec知道如何将线上的字节解码为具体类型,用法类似net/rpc的Register
+var (
+	typesMu  sync.RWMutex
+	argTypes = make(map[string][]reflect.Type)
+	retTypes = make(map[string][]reflect.Type)
+)
+
+//注册id对应的参数类型,必须在TransportServer开始收发消息之前调用
+func RegisterArgTypes(id string, types ...reflect.Type) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+
+	if _, ok := argTypes[id]; ok {
+		panic(fmt.Sprintf("transport: arg types for id %v already registered", id))
+	}
+	argTypes[id] = types
+}
+
+//注册id对应的返回值类型,可选;未注册时按interface{}解码,对gob编解码器而言这通常会失败
+func RegisterReturnTypes(id string, types ...reflect.Type) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+
+	if _, ok := retTypes[id]; ok {
+		panic(fmt.Sprintf("transport: return types for id %v already registered", id))
+	}
+	retTypes[id] = types
+}
+
+func lookupArgTypes(id string) ([]reflect.Type, error) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+
+	types, ok := argTypes[id]
+	if !ok {
+		return nil, fmt.Errorf("transport: arg types for id %v not registered", id)
+	}
+	return types, nil
+}
+
+func lookupReturnType(id string, index int) reflect.Type {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+
+	types := retTypes[id]
+	if index < len(types) {
+		return types[index]
+	}
+	return nil
+}
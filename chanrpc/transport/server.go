@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/name5566/leaf/chanrpc"
+)
+
+//TransportServer 将一个chanrpc.Server桥接为网络服务端
+//连接上收到的每个请求被解码后,通过为该请求单独Open的chanrpc.Client转发到同一个chanrpc.Server,
+//因此现有的handler注册方式完全不需要改变,本地调用和跨进程调用共用同一套handler
+//注意:帧本身固定是gob编码(见serveConn),Codec只负责帧内参数/返回值的编解码,
+//因此目前仅限Go进程之间互通,不是一个可以让非Go对端接入的跨语言协议
+type TransportServer struct {
+	Server *chanrpc.Server //被桥接的chanrpc服务器
+	Codec  Codec           //参数/返回值编解码器,帧本身固定用gob编码,见本文件顶部注释
+
+	listener net.Listener
+}
+
+//监听network/addr并开始接受连接,阻塞直至Close或Accept出错
+func (ts *TransportServer) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return ts.Serve(l)
+}
+
+//在已有的net.Listener上开始接受连接
+//注意:当前只实现了裸TCP上的帧协议,传入一个WebSocket握手后的net.Conn/net.Listener无法直接工作,
+//因为gob编解码器会把WS的帧头当成协议数据;要支持WebSocket还需要额外一层去掉/加上WS帧的net.Conn适配器
+func (ts *TransportServer) Serve(l net.Listener) error {
+	ts.listener = l
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go ts.serveConn(conn)
+	}
+}
+
+//关闭监听,已建立的连接不受影响
+func (ts *TransportServer) Close() error {
+	if ts.listener == nil {
+		return nil
+	}
+	return ts.listener.Close()
+}
+
+func (ts *TransportServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(conn))
+	enc := gob.NewEncoder(conn)
+	var encMu sync.Mutex //gob.Encoder不是并发安全的,多个请求的响应可能并发写回
+
+	for {
+		req := new(request)
+		if err := dec.Decode(req); err != nil {
+			return //连接断开或协议错误,结束该连接的服务
+		}
+
+		go func(req *request) { //并发处理请求,避免慢调用阻塞同一连接上的其它请求
+			//chanrpc.Client不是goroutine安全的:一条连接上流水线处理的多个请求若共用同一个Client,
+			//会争抢同一个chanSyncRet,导致彼此的RetInfo串台。这里按请求各开各的Client,用完即关闭
+			c := ts.Server.Open(1)
+			defer c.Close()
+
+			resp := ts.handle(c, req)
+
+			encMu.Lock()
+			defer encMu.Unlock()
+			enc.Encode(resp) //写回失败说明连接已经不可用,下一次Decode会感知并结束serveConn
+		}(req)
+	}
+}
+
+func (ts *TransportServer) handle(c *chanrpc.Client, req *request) *response {
+	types, err := lookupArgTypes(req.Id)
+	if err != nil {
+		return &response{Seq: req.Seq, Err: err.Error()}
+	}
+
+	args, err := decodeArgs(ts.Codec, req.Args, types)
+	if err != nil {
+		return &response{Seq: req.Seq, Err: err.Error()}
+	}
+
+	n, ok := ts.Server.Arity(req.Id)
+	if !ok {
+		return &response{Seq: req.Seq, Err: fmt.Sprintf("transport: function id %v not registered", req.Id)}
+	}
+
+	var values []interface{}
+	switch n {
+	case 0:
+		err = c.Call0(req.Id, args...)
+	case 1:
+		var ret interface{}
+		ret, err = c.Call1(req.Id, args...)
+		if err == nil {
+			values = []interface{}{ret}
+		}
+	case 2:
+		values, err = c.CallN(req.Id, args...)
+	default:
+		err = fmt.Errorf("transport: function id %v does not support remote calls", req.Id)
+	}
+
+	if err != nil {
+		return &response{Seq: req.Seq, Err: err.Error()}
+	}
+
+	ret, err := encodeValues(ts.Codec, values)
+	if err != nil {
+		return &response{Seq: req.Seq, Err: err.Error()}
+	}
+	return &response{Seq: req.Seq, Ret: ret}
+}
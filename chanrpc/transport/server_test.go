@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"math/rand"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/name5566/leaf/chanrpc"
+)
+
+//serveConn曾经让一条连接上流水线处理的所有请求共用同一个chanrpc.Client,
+//而Client不是goroutine安全的,并发调用会串台拿到彼此的返回值。这里并发打一批
+//各自携带不同值的请求,确认每个请求收到的都是自己的值
+func TestServeConnDoesNotCrossWireConcurrentRequests(t *testing.T) {
+	const id = "transport_test.Echo"
+
+	s := chanrpc.NewServer(64)
+	s.Register(id, func(args []interface{}) interface{} {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond) //随机延迟,放大请求间的交错
+		return args[0]
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+
+	RegisterArgTypes(id, reflect.TypeOf(0))
+	RegisterReturnTypes(id, reflect.TypeOf(0))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &TransportServer{Server: s, Codec: GobCodec}
+	go ts.Serve(l)
+	defer ts.Close()
+
+	rc, err := Dial("tcp", l.Addr().String(), GobCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	const n = 200
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(want int) {
+			defer wg.Done()
+			ret, err := rc.Call1(id, want)
+			if err != nil {
+				t.Errorf("Call1(%d): %v", want, err)
+				return
+			}
+			if got := ret.(int); got != want {
+				t.Errorf("Call1(%d): got cross-wired result %d", want, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+}